@@ -0,0 +1,161 @@
+package pixy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/Godeps/_workspace/src/gopkg.in/yaml.v2"
+)
+
+// envPrefix is prepended to every environment variable name that
+// `applyEnvOverrides` looks up.
+const envPrefix = "KAFKAPIXY_"
+
+// LoadConfig builds a `Config` seeded with `NewConfig()` defaults, then
+// overlays it with a YAML file (JSON is a valid subset of YAML, so `.json`
+// config files work too) and, on top of that, with `KAFKAPIXY_*` environment
+// variables. `path` may be empty, in which case only the environment
+// overrides are applied. Every `Duration` field in the file accepts either a
+// natural string like `"3s"` or a raw number of nanoseconds; the
+// `KAFKAPIXY_*` duration env vars below accept only the natural string form.
+// The returned config is validated before it is returned.
+func LoadConfig(path string) (*Config, error) {
+	config := NewConfig()
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file %s, err=(%s)", path, err)
+		}
+		if err := yaml.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s, err=(%s)", path, err)
+		}
+	}
+	config.sourcePath = path
+	config.applyEnvOverrides()
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config, err=(%s)", err)
+	}
+	return config, nil
+}
+
+// applyEnvOverrides overlays a handful of frequently re-tuned settings with
+// values taken from `KAFKAPIXY_*` environment variables, if they are set. It
+// covers only tunables that `ReloadConfig` is allowed to apply on a running
+// `Service`, and not all of them: `Producer.Flush.Frequency` and
+// `Producer.Flush.Bytes` have no environment override.
+func (c *Config) applyEnvOverrides() {
+	if v, err := envDuration("CONSUMER_LONG_POLLING_TIMEOUT"); err == nil {
+		c.Consumer.LongPollingTimeout = v
+	}
+	if v, err := envDuration("CONSUMER_REBALANCE_DELAY"); err == nil {
+		c.Consumer.RebalanceDelay = v
+	}
+	if v, err := envDuration("CONSUMER_BACK_OFF_TIMEOUT"); err == nil {
+		c.Consumer.BackOffTimeout = v
+	}
+	if v, ok := os.LookupEnv(envPrefix + "CHANNEL_BUFFER_SIZE"); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.ChannelBufferSize = n
+		}
+	}
+}
+
+// envDuration looks up `KAFKAPIXY_<name>` and parses it as a `Duration`.
+func envDuration(name string) (Duration, error) {
+	v, ok := os.LookupEnv(envPrefix + name)
+	if !ok {
+		return 0, fmt.Errorf("%s%s is not set", envPrefix, name)
+	}
+	parsed, err := time.ParseDuration(v)
+	return Duration(parsed), err
+}
+
+// Validate checks that the tunables that can cause havoc when misconfigured
+// are within sane bounds. It is called by `LoadConfig`, and through it by
+// `Service.ReloadConfig` before a reloaded config is applied.
+func (c *Config) Validate() error {
+	if c.ChannelBufferSize <= 0 {
+		return fmt.Errorf("Config.ChannelBufferSize must be greater than 0, got %d", c.ChannelBufferSize)
+	}
+	if c.Consumer.LongPollingTimeout < 0 {
+		return fmt.Errorf("Config.Consumer.LongPollingTimeout must not be negative, got %s", c.Consumer.LongPollingTimeout)
+	}
+	if c.Consumer.RegistrationTimeout < 0 {
+		return fmt.Errorf("Config.Consumer.RegistrationTimeout must not be negative, got %s", c.Consumer.RegistrationTimeout)
+	}
+	if c.Consumer.BackOffTimeout < 0 {
+		return fmt.Errorf("Config.Consumer.BackOffTimeout must not be negative, got %s", c.Consumer.BackOffTimeout)
+	}
+	if c.Consumer.RebalanceDelay < 0 {
+		return fmt.Errorf("Config.Consumer.RebalanceDelay must not be negative, got %s", c.Consumer.RebalanceDelay)
+	}
+	switch c.Consumer.OffsetStorage {
+	case OffsetStorageZooKeeper, OffsetStorageKafka:
+	default:
+		return fmt.Errorf("Config.Consumer.OffsetStorage must be %q or %q, got %q",
+			OffsetStorageZooKeeper, OffsetStorageKafka, c.Consumer.OffsetStorage)
+	}
+	if c.Consumer.OffsetStorage == OffsetStorageZooKeeper && len(c.ZooKeeper.SeedPeers) == 0 {
+		return fmt.Errorf("Config.ZooKeeper.SeedPeers must not be empty when Config.Consumer.OffsetStorage is %q",
+			OffsetStorageZooKeeper)
+	}
+	if c.Kafka.Breaker.ErrorThreshold <= 0 {
+		return fmt.Errorf("Config.Kafka.Breaker.ErrorThreshold must be greater than 0, got %d", c.Kafka.Breaker.ErrorThreshold)
+	}
+	if c.Kafka.Breaker.SuccessThreshold <= 0 {
+		return fmt.Errorf("Config.Kafka.Breaker.SuccessThreshold must be greater than 0, got %d", c.Kafka.Breaker.SuccessThreshold)
+	}
+	if c.Kafka.Breaker.Timeout <= 0 {
+		return fmt.Errorf("Config.Kafka.Breaker.Timeout must be greater than 0, got %s", c.Kafka.Breaker.Timeout)
+	}
+	if c.Kafka.SASL.Enabled {
+		switch c.Kafka.SASL.Mechanism {
+		case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+		default:
+			return fmt.Errorf("Config.Kafka.SASL.Mechanism must be %q, %q or %q, got %q",
+				"PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512", c.Kafka.SASL.Mechanism)
+		}
+	}
+	if (c.Kafka.TLS.CertFile == "") != (c.Kafka.TLS.KeyFile == "") {
+		return fmt.Errorf("Config.Kafka.TLS.CertFile and Config.Kafka.TLS.KeyFile must be set together")
+	}
+	if (c.ZooKeeper.TLS.CertFile == "") != (c.ZooKeeper.TLS.KeyFile == "") {
+		return fmt.Errorf("Config.ZooKeeper.TLS.CertFile and Config.ZooKeeper.TLS.KeyFile must be set together")
+	}
+	return nil
+}
+
+// hotConfigDiff compares the tunables that `Service.ReloadConfig` is allowed
+// to apply live and returns a human readable line per changed one. It is
+// used to log exactly what changed when a config reload happens.
+func hotConfigDiff(old, new *Config) []string {
+	var diffs []string
+	if old.Consumer.LongPollingTimeout != new.Consumer.LongPollingTimeout {
+		diffs = append(diffs, fmt.Sprintf("Consumer.LongPollingTimeout: %s -> %s",
+			old.Consumer.LongPollingTimeout, new.Consumer.LongPollingTimeout))
+	}
+	if old.Consumer.RebalanceDelay != new.Consumer.RebalanceDelay {
+		diffs = append(diffs, fmt.Sprintf("Consumer.RebalanceDelay: %s -> %s",
+			old.Consumer.RebalanceDelay, new.Consumer.RebalanceDelay))
+	}
+	if old.Consumer.BackOffTimeout != new.Consumer.BackOffTimeout {
+		diffs = append(diffs, fmt.Sprintf("Consumer.BackOffTimeout: %s -> %s",
+			old.Consumer.BackOffTimeout, new.Consumer.BackOffTimeout))
+	}
+	if old.ChannelBufferSize != new.ChannelBufferSize {
+		diffs = append(diffs, fmt.Sprintf("ChannelBufferSize: %d -> %d",
+			old.ChannelBufferSize, new.ChannelBufferSize))
+	}
+	if old.Producer.Flush.Frequency != new.Producer.Flush.Frequency {
+		diffs = append(diffs, fmt.Sprintf("Producer.Flush.Frequency: %s -> %s",
+			old.Producer.Flush.Frequency, new.Producer.Flush.Frequency))
+	}
+	if old.Producer.Flush.Bytes != new.Producer.Flush.Bytes {
+		diffs = append(diffs, fmt.Sprintf("Producer.Flush.Bytes: %d -> %d",
+			old.Producer.Flush.Bytes, new.Producer.Flush.Bytes))
+	}
+	return diffs
+}
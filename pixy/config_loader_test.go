@@ -0,0 +1,251 @@
+package pixy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/Godeps/_workspace/src/gopkg.in/yaml.v2"
+)
+
+func TestConfigValidate(t *testing.T) {
+	valid := func() *Config {
+		c := NewConfig()
+		c.ZooKeeper.SeedPeers = []string{"localhost:2181"}
+		return c
+	}
+
+	testCases := []struct {
+		name    string
+		mutate  func(c *Config)
+		wantErr string
+	}{
+		{
+			name:   "defaults are valid",
+			mutate: func(c *Config) {},
+		},
+		{
+			name:    "non-positive ChannelBufferSize",
+			mutate:  func(c *Config) { c.ChannelBufferSize = 0 },
+			wantErr: "Config.ChannelBufferSize",
+		},
+		{
+			name:    "negative Consumer.LongPollingTimeout",
+			mutate:  func(c *Config) { c.Consumer.LongPollingTimeout = Duration(-time.Second) },
+			wantErr: "Config.Consumer.LongPollingTimeout",
+		},
+		{
+			name:    "negative Consumer.RegistrationTimeout",
+			mutate:  func(c *Config) { c.Consumer.RegistrationTimeout = Duration(-time.Second) },
+			wantErr: "Config.Consumer.RegistrationTimeout",
+		},
+		{
+			name:    "negative Consumer.BackOffTimeout",
+			mutate:  func(c *Config) { c.Consumer.BackOffTimeout = Duration(-time.Second) },
+			wantErr: "Config.Consumer.BackOffTimeout",
+		},
+		{
+			name:    "negative Consumer.RebalanceDelay",
+			mutate:  func(c *Config) { c.Consumer.RebalanceDelay = Duration(-time.Second) },
+			wantErr: "Config.Consumer.RebalanceDelay",
+		},
+		{
+			name:    "unknown Consumer.OffsetStorage",
+			mutate:  func(c *Config) { c.Consumer.OffsetStorage = "bogus" },
+			wantErr: "Config.Consumer.OffsetStorage",
+		},
+		{
+			name: "zookeeper OffsetStorage without SeedPeers",
+			mutate: func(c *Config) {
+				c.Consumer.OffsetStorage = OffsetStorageZooKeeper
+				c.ZooKeeper.SeedPeers = nil
+			},
+			wantErr: "Config.ZooKeeper.SeedPeers",
+		},
+		{
+			name:    "non-positive Kafka.Breaker.ErrorThreshold",
+			mutate:  func(c *Config) { c.Kafka.Breaker.ErrorThreshold = 0 },
+			wantErr: "Config.Kafka.Breaker.ErrorThreshold",
+		},
+		{
+			name:    "non-positive Kafka.Breaker.SuccessThreshold",
+			mutate:  func(c *Config) { c.Kafka.Breaker.SuccessThreshold = 0 },
+			wantErr: "Config.Kafka.Breaker.SuccessThreshold",
+		},
+		{
+			name:    "non-positive Kafka.Breaker.Timeout",
+			mutate:  func(c *Config) { c.Kafka.Breaker.Timeout = 0 },
+			wantErr: "Config.Kafka.Breaker.Timeout",
+		},
+		{
+			name: "unknown SASL mechanism",
+			mutate: func(c *Config) {
+				c.Kafka.SASL.Enabled = true
+				c.Kafka.SASL.Mechanism = "bogus"
+			},
+			wantErr: "Config.Kafka.SASL.Mechanism",
+		},
+		{
+			name: "SASL disabled ignores unknown mechanism",
+			mutate: func(c *Config) {
+				c.Kafka.SASL.Enabled = false
+				c.Kafka.SASL.Mechanism = "bogus"
+			},
+		},
+		{
+			name:    "Kafka.TLS.CertFile without KeyFile",
+			mutate:  func(c *Config) { c.Kafka.TLS.CertFile = "cert.pem" },
+			wantErr: "Config.Kafka.TLS.CertFile and Config.Kafka.TLS.KeyFile",
+		},
+		{
+			name:    "Kafka.TLS.KeyFile without CertFile",
+			mutate:  func(c *Config) { c.Kafka.TLS.KeyFile = "key.pem" },
+			wantErr: "Config.Kafka.TLS.CertFile and Config.Kafka.TLS.KeyFile",
+		},
+		{
+			name:    "ZooKeeper.TLS.CertFile without KeyFile",
+			mutate:  func(c *Config) { c.ZooKeeper.TLS.CertFile = "cert.pem" },
+			wantErr: "Config.ZooKeeper.TLS.CertFile and Config.ZooKeeper.TLS.KeyFile",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := valid()
+			tc.mutate(c)
+			err := c.Validate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error containing %q, got nil", tc.wantErr)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error to contain %q, got %q", tc.wantErr, err.Error())
+			}
+		})
+	}
+}
+
+func TestHotConfigDiff(t *testing.T) {
+	old := NewConfig()
+	new := NewConfig()
+
+	if diffs := hotConfigDiff(old, new); len(diffs) != 0 {
+		t.Fatalf("expected no diffs for identical configs, got %v", diffs)
+	}
+
+	new.Consumer.LongPollingTimeout = Duration(42 * time.Second)
+	new.ChannelBufferSize = old.ChannelBufferSize + 1
+	new.Producer.Flush.Bytes = old.Producer.Flush.Bytes + 1
+
+	diffs := hotConfigDiff(old, new)
+	if len(diffs) != 3 {
+		t.Fatalf("expected 3 diffs, got %d: %v", len(diffs), diffs)
+	}
+}
+
+func TestEnvDuration(t *testing.T) {
+	const name = "CONSUMER_LONG_POLLING_TIMEOUT"
+	os.Unsetenv(envPrefix + name)
+	if _, err := envDuration(name); err == nil {
+		t.Fatal("expected an error when the env var is unset")
+	}
+
+	os.Setenv(envPrefix+name, "3s")
+	defer os.Unsetenv(envPrefix + name)
+	got, err := envDuration(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if time.Duration(got) != 3*time.Second {
+		t.Fatalf("got %s, want 3s", time.Duration(got))
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	os.Setenv(envPrefix+"CONSUMER_LONG_POLLING_TIMEOUT", "7s")
+	os.Setenv(envPrefix+"CHANNEL_BUFFER_SIZE", "42")
+	defer os.Unsetenv(envPrefix + "CONSUMER_LONG_POLLING_TIMEOUT")
+	defer os.Unsetenv(envPrefix + "CHANNEL_BUFFER_SIZE")
+
+	c := NewConfig()
+	c.applyEnvOverrides()
+
+	if time.Duration(c.Consumer.LongPollingTimeout) != 7*time.Second {
+		t.Errorf("Consumer.LongPollingTimeout = %s, want 7s", time.Duration(c.Consumer.LongPollingTimeout))
+	}
+	if c.ChannelBufferSize != 42 {
+		t.Errorf("ChannelBufferSize = %d, want 42", c.ChannelBufferSize)
+	}
+}
+
+func TestLoadConfigParsesNaturalDurationStrings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kafka-pixy-config-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	yamlDoc := `
+zookeeper:
+  seedpeers:
+    - localhost:2181
+consumer:
+  longpollingtimeout: 7s
+producer:
+  shutdowntimeout: 1m
+  flush:
+    frequency: 250ms
+kafka:
+  breaker:
+    timeout: 5s
+`
+	if err := ioutil.WriteFile(path, []byte(yamlDoc), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if time.Duration(config.Consumer.LongPollingTimeout) != 7*time.Second {
+		t.Errorf("Consumer.LongPollingTimeout = %s, want 7s", time.Duration(config.Consumer.LongPollingTimeout))
+	}
+	if time.Duration(config.Producer.ShutdownTimeout) != time.Minute {
+		t.Errorf("Producer.ShutdownTimeout = %s, want 1m", time.Duration(config.Producer.ShutdownTimeout))
+	}
+	if time.Duration(config.Producer.Flush.Frequency) != 250*time.Millisecond {
+		t.Errorf("Producer.Flush.Frequency = %s, want 250ms", time.Duration(config.Producer.Flush.Frequency))
+	}
+	if time.Duration(config.Kafka.Breaker.Timeout) != 5*time.Second {
+		t.Errorf("Kafka.Breaker.Timeout = %s, want 5s", time.Duration(config.Kafka.Breaker.Timeout))
+	}
+}
+
+func TestDurationUnmarshalYAMLRejectsGarbage(t *testing.T) {
+	var d Duration
+	if err := yaml.Unmarshal([]byte("not-a-duration"), &d); err == nil {
+		t.Fatal("expected an error for a malformed duration string")
+	}
+	if err := yaml.Unmarshal([]byte("[1, 2]"), &d); err == nil {
+		t.Fatal("expected an error for a duration given as a list")
+	}
+}
+
+func TestDurationUnmarshalYAMLAcceptsNanoseconds(t *testing.T) {
+	var d Duration
+	if err := yaml.Unmarshal([]byte("1500000000"), &d); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if time.Duration(d) != 1500*time.Millisecond {
+		t.Fatalf("got %s, want 1.5s", time.Duration(d))
+	}
+}
@@ -0,0 +1,42 @@
+package pixy
+
+import (
+	"fmt"
+	"time"
+)
+
+// Duration is a `time.Duration` that unmarshals from YAML as either a
+// natural string like `"3s"` or `"500ms"` (parsed with `time.ParseDuration`,
+// the same as `applyEnvOverrides` already does for `KAFKAPIXY_*` env vars)
+// or a raw number of nanoseconds, for backwards compatibility.
+type Duration time.Duration
+
+// String renders `d` the way a `time.Duration` would, e.g. `"3s"`.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// UnmarshalYAML implements `yaml.Unmarshaler`.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	switch v := raw.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, err=(%s)", v, err)
+		}
+		*d = Duration(parsed)
+	case int:
+		*d = Duration(time.Duration(v))
+	case int64:
+		*d = Duration(time.Duration(v))
+	case float64:
+		*d = Duration(time.Duration(int64(v)))
+	default:
+		return fmt.Errorf("invalid duration %v (%T), must be a string like \"3s\" or a number of nanoseconds", raw, raw)
+	}
+	return nil
+}
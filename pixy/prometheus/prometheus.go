@@ -0,0 +1,135 @@
+// Package prometheus bridges the `rcrowley/go-metrics` registry that
+// `Shopify/sarama` reports per-broker latency, request rate, batch size and
+// compression ratio meters into, plus a handful of Kafka-Pixy specific
+// counters, into the Prometheus text exposition format.
+//
+// `pixy.SpawnService` builds one `Metrics` per `Config.MetricRegistry` and
+// exposes it through `Service.Metrics()`. `HTTPAPIServer` should mount
+// `Metrics().Handler()` at `/metrics` on both the Unix and TCP listeners once
+// it grows that route, and `GracefulProducer`/`SmartConsumer`/`Admin` should
+// call the counter methods below as they produce, consume and rebalance;
+// none of those three exist in this checkout yet, so the counters currently
+// only ever read zero.
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mailgun/kafka-pixy/Godeps/_workspace/src/github.com/rcrowley/go-metrics"
+)
+
+// Metrics bundles the shared go-metrics registry handed to sarama with the
+// Kafka-Pixy specific counters that have no sarama meter of their own.
+type Metrics struct {
+	registry metrics.Registry
+
+	produceSuccesses metrics.Counter
+	produceFailures  metrics.Counter
+	consumeTimeouts  metrics.Counter
+	rebalances       metrics.Counter
+	deadLetterDrops  metrics.Counter
+}
+
+// New creates a `Metrics` bridge around `registry`, the same registry that
+// should be assigned to `sarama.Config.MetricRegistry` so that broker level
+// stats end up in the same `/metrics` output as the Kafka-Pixy counters
+// below.
+func New(registry metrics.Registry) *Metrics {
+	return &Metrics{
+		registry:         registry,
+		produceSuccesses: metrics.NewRegisteredCounter("kafkapixy.produce.successes", registry),
+		produceFailures:  metrics.NewRegisteredCounter("kafkapixy.produce.failures", registry),
+		consumeTimeouts:  metrics.NewRegisteredCounter("kafkapixy.consume.long_polling_timeouts", registry),
+		rebalances:       metrics.NewRegisteredCounter("kafkapixy.consumer.rebalances", registry),
+		deadLetterDrops:  metrics.NewRegisteredCounter("kafkapixy.producer.dead_letter_drops", registry),
+	}
+}
+
+// ProduceSuccess increments the count of messages successfully produced.
+func (m *Metrics) ProduceSuccess() { m.produceSuccesses.Inc(1) }
+
+// ProduceFailure increments the count of messages that failed to produce.
+func (m *Metrics) ProduceFailure() { m.produceFailures.Inc(1) }
+
+// ConsumeTimeout increments the count of consume requests that hit
+// `Consumer.LongPollingTimeout` without a message becoming available.
+func (m *Metrics) ConsumeTimeout() { m.consumeTimeouts.Inc(1) }
+
+// Rebalance increments the count of consumer group rebalances performed.
+func (m *Metrics) Rebalance() { m.rebalances.Inc(1) }
+
+// DeadLetterDrop increments the count of messages dumped to the dead letter
+// channel because they could not be delivered.
+func (m *Metrics) DeadLetterDrop() { m.deadLetterDrops.Inc(1) }
+
+// Handler returns an `http.Handler` that renders the bridged registry in the
+// Prometheus text exposition format. It is meant to be mounted at
+// `/metrics`.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeRegistry(w, m.registry)
+	})
+}
+
+// writeRegistry renders every meter/counter/histogram/gauge in `registry` as
+// a Prometheus sample line. Metric names are sanitized to the
+// `[a-zA-Z_:][a-zA-Z0-9_:]*` charset that Prometheus requires.
+func writeRegistry(w io.Writer, registry metrics.Registry) {
+	names := make([]string, 0)
+	snapshot := make(map[string]interface{})
+	var mu sync.Mutex
+
+	registry.Each(func(name string, metric interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		names = append(names, name)
+		snapshot[name] = metric
+	})
+	sort.Strings(names)
+
+	for _, name := range names {
+		promName := sanitizeName(name)
+		switch m := snapshot[name].(type) {
+		case metrics.Counter:
+			fmt.Fprintf(w, "%s %d\n", promName, m.Count())
+		case metrics.Gauge:
+			fmt.Fprintf(w, "%s %d\n", promName, m.Value())
+		case metrics.GaugeFloat64:
+			fmt.Fprintf(w, "%s %g\n", promName, m.Value())
+		case metrics.Meter:
+			fmt.Fprintf(w, "%s %d\n", promName, m.Count())
+		case metrics.Histogram:
+			snap := m.Snapshot()
+			fmt.Fprintf(w, "%s_count %d\n", promName, snap.Count())
+			fmt.Fprintf(w, "%s_sum %d\n", promName, snap.Sum())
+		case metrics.Timer:
+			snap := m.Snapshot()
+			fmt.Fprintf(w, "%s_count %d\n", promName, snap.Count())
+			fmt.Fprintf(w, "%s_sum %d\n", promName, snap.Sum())
+		}
+	}
+}
+
+// sanitizeName replaces characters not allowed in Prometheus metric names
+// with underscores.
+func sanitizeName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	// A digit is not allowed as the first character of a metric name.
+	if sanitized != "" && sanitized[0] >= '0' && sanitized[0] <= '9' {
+		sanitized = "_" + sanitized[1:]
+	}
+	return sanitized
+}
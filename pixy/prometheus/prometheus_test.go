@@ -0,0 +1,63 @@
+package prometheus
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mailgun/kafka-pixy/Godeps/_workspace/src/github.com/rcrowley/go-metrics"
+)
+
+func TestSanitizeName(t *testing.T) {
+	testCases := []struct {
+		name string
+		want string
+	}{
+		{"kafkapixy.produce.successes", "kafkapixy_produce_successes"},
+		{"already_sane:name", "already_sane:name"},
+		{"weird name/with spaces", "weird_name_with_spaces"},
+		{"", ""},
+	}
+	for _, tc := range testCases {
+		if got := sanitizeName(tc.name); got != tc.want {
+			t.Errorf("sanitizeName(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestWriteRegistry(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("kafkapixy.produce.successes", registry).Inc(3)
+	metrics.GetOrRegisterGauge("kafkapixy.queue.depth", registry).Update(7)
+
+	var buf bytes.Buffer
+	writeRegistry(&buf, registry)
+	out := buf.String()
+
+	if !strings.Contains(out, "kafkapixy_produce_successes 3\n") {
+		t.Errorf("expected a sanitized counter line, got:\n%s", out)
+	}
+	if !strings.Contains(out, "kafkapixy_queue_depth 7\n") {
+		t.Errorf("expected a sanitized gauge line, got:\n%s", out)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	registry := metrics.NewRegistry()
+	m := New(registry)
+	m.ProduceSuccess()
+	m.ProduceSuccess()
+	m.DeadLetterDrop()
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+
+	if !strings.Contains(out, "kafkapixy_produce_successes 2\n") {
+		t.Errorf("expected ProduceSuccess to be counted twice, got:\n%s", out)
+	}
+	if !strings.Contains(out, "kafkapixy_producer_dead_letter_drops 1\n") {
+		t.Errorf("expected DeadLetterDrop to be counted once, got:\n%s", out)
+	}
+}
@@ -2,14 +2,47 @@ package pixy
 
 import (
 	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/mailgun/kafka-pixy/Godeps/_workspace/src/github.com/eapache/go-resiliency/breaker"
 	"github.com/mailgun/kafka-pixy/Godeps/_workspace/src/github.com/mailgun/log"
 	"github.com/mailgun/kafka-pixy/Godeps/_workspace/src/github.com/mailgun/sarama"
+	"github.com/mailgun/kafka-pixy/Godeps/_workspace/src/github.com/rcrowley/go-metrics"
 	"github.com/mailgun/kafka-pixy/Godeps/_workspace/src/github.com/wvanbergen/kazoo-go"
+	"github.com/mailgun/kafka-pixy/pixy/prometheus"
+)
+
+// OffsetStorage selects where consumer group offsets, and group membership
+// itself, are coordinated.
+//
+// As of this checkout only the `zookeeper` path is actually implemented:
+// `SpawnSmartConsumer`/`SpawnAdmin` (not present here) coordinate through
+// `kazoo-go` the classic way. Setting `kafka` only stops `SpawnService` from
+// opening a ZooKeeper connection (see `needsZooKeeper`) — the Kafka-native
+// JoinGroup/SyncGroup/Heartbeat and `__consumer_offsets` OffsetCommit/Fetch
+// protocol itself still needs to be written into `SmartConsumer`.
+type OffsetStorage string
+
+const (
+	// OffsetStorageZooKeeper coordinates consumer groups the classic
+	// Kafka-Pixy way, through `kazoo-go` znodes. It requires a running
+	// ZooKeeper ensemble.
+	OffsetStorageZooKeeper OffsetStorage = "zookeeper"
+	// OffsetStorageKafka is meant to coordinate consumer groups using
+	// Kafka's own group membership protocol (JoinGroup/SyncGroup/Heartbeat)
+	// and commit offsets to the `__consumer_offsets` topic, the way 0.9+
+	// clients do, needing no ZooKeeper access at all. Selecting it today
+	// only skips the ZooKeeper connection; see the `OffsetStorage` doc above.
+	OffsetStorageKafka OffsetStorage = "kafka"
 )
 
 type Config struct {
@@ -25,6 +58,49 @@ type Config struct {
 		// A list of seed Kafka peers in the form "<host>:<port>" that the
 		// service will try to connect to to resolve the cluster topology.
 		SeedPeers []string
+		// TLS holds the parameters needed to establish an encrypted
+		// connection to brokers that require it.
+		TLS struct {
+			// Enabled turns TLS on for all connections to Kafka brokers.
+			Enabled bool
+			// CAFile is a path to a PEM encoded CA certificates bundle used
+			// to verify the broker certificate. If empty the system pool is
+			// used.
+			CAFile string
+			// CertFile and KeyFile are paths to a PEM encoded client
+			// certificate/key pair presented to brokers that require client
+			// authentication.
+			CertFile string
+			KeyFile  string
+			// InsecureSkipVerify disables broker certificate verification.
+			// It should only be used for testing.
+			InsecureSkipVerify bool
+		}
+		// SASL holds credentials used to authenticate with brokers that have
+		// SASL enabled.
+		SASL struct {
+			// Enabled turns SASL authentication on for all connections to
+			// Kafka brokers.
+			Enabled bool
+			// Mechanism is either `PLAIN` or `SCRAM-SHA-256`/`SCRAM-SHA-512`.
+			Mechanism string
+			Username  string
+			Password  string
+		}
+		// Breaker configures the per-broker circuit breakers handed out by
+		// `Service.Breaker`. No producer, consumer or admin call in this
+		// package is run through them.
+		Breaker struct {
+			// ErrorThreshold is the number of consecutive failures that
+			// trips the breaker open.
+			ErrorThreshold int
+			// SuccessThreshold is the number of consecutive successes in the
+			// half-open state required to close the breaker again.
+			SuccessThreshold int
+			// Timeout is how long the breaker stays open before it lets a
+			// single probe request through to test the water.
+			Timeout Duration
+		}
 	}
 	ZooKeeper struct {
 		// A list of seed ZooKeeper peers in the form "<host>:<port>" that the
@@ -32,54 +108,125 @@ type Config struct {
 		SeedPeers []string
 		// The root directory where Kafka keeps all its znodes.
 		Chroot string
+		// TLS holds the parameters for an encrypted connection to ZooKeeper
+		// peers. Only `Validate` reads them; the ZooKeeper connection is
+		// made without TLS (see `kazooConfig`).
+		TLS struct {
+			Enabled            bool
+			CAFile             string
+			CertFile           string
+			KeyFile            string
+			InsecureSkipVerify bool
+		}
+		// Auth holds digest authentication credentials for the ZooKeeper
+		// session. They are not added to the session by this package (see
+		// `kazooConfig`).
+		Auth struct {
+			Enabled  bool
+			Username string
+			Password string
+		}
 	}
 	Producer struct {
 		// The period of time that a proxy should allow to `sarama.Producer` to
 		// submit buffered messages to Kafka. It should be large enough to avoid
 		// event loss when shutdown is performed during Kafka leader election.
-		ShutdownTimeout time.Duration
+		ShutdownTimeout Duration
 		// DeadMessageCh is a channel to dump undelivered messages into. It is
 		// used in testing only.
 		DeadMessageCh chan<- *sarama.ProducerMessage
+		// RequiredAcks controls how many replicas must acknowledge a message
+		// before a produce call is considered successful.
+		RequiredAcks sarama.RequiredAcks
+		// Compression names the codec used to compress produced messages:
+		// `none`, `gzip`, `snappy`, `lz4` or `zstd`.
+		Compression string
+		// Idempotent turns on Kafka's idempotent producer. It requires
+		// `RequiredAcks` to be `sarama.WaitForAll`.
+		Idempotent bool
+		// MaxMessageBytes caps the size of a single produced message. Zero
+		// means sarama's own default applies.
+		MaxMessageBytes int
+		Flush struct {
+			// Frequency is the longest a message can sit in the producer's
+			// buffer before being flushed to Kafka.
+			Frequency Duration
+			// Bytes is how many buffered bytes trigger an early flush.
+			Bytes int
+		}
 	}
 	Consumer struct {
+		// OffsetStorage selects how consumer group membership and offsets
+		// are coordinated: `zookeeper` (default, via `kazoo-go`) or `kafka`.
+		// In `kafka` mode `SpawnService` opens no ZooKeeper connection and
+		// `ZooKeeper.SeedPeers` is not needed; nothing in this package
+		// coordinates groups or offsets through Kafka's group membership
+		// protocol or the `__consumer_offsets` topic.
+		OffsetStorage OffsetStorage
 		// A consume request will wait at most this long until a message from
 		// the specified group/topic becomes available. This timeout is
 		// necessary to account for consumer rebalancing that happens whenever
 		// a new consumer joins a group or subscribes to a topic.
-		LongPollingTimeout time.Duration
+		LongPollingTimeout Duration
 		// The period of time that a proxy should keep registration with a
 		// consumer group or subscription for a topic in the absence of requests
 		// to the aforementioned consumer group or topic.
-		RegistrationTimeout time.Duration
+		RegistrationTimeout Duration
 		// If a request to a KafkaBroker fails for any reason then the proxy
 		// should wait this long before retrying.
-		BackOffTimeout time.Duration
+		BackOffTimeout Duration
 		// A consumer should wait this long after it gets notification that a
 		// consumer joined/left its consumer group before it should rebalance.
-		RebalanceDelay time.Duration
+		RebalanceDelay Duration
 	}
 	// All buffered channels created by the service will have this size.
 	ChannelBufferSize int
+	// MetricRegistry is the `go-metrics` registry that sarama reports
+	// per-broker latency, request rate, batch size and compression ratio
+	// meters into. It is shared with the `prometheus` package so that
+	// `Service.Metrics().Handler()` renders those meters alongside the
+	// Kafka-Pixy specific counters. No HTTP route serves that handler in
+	// this package.
+	MetricRegistry metrics.Registry
 	// testing sections contains parameters that are used in tests only.
 	testing struct {
 		// If this channel is not `nil` then exclusive consumers will use it to
 		// notify when they fetch the very first message.
 		firstMessageFetchedCh chan *exclusiveConsumer
 	}
+
+	// mu guards the tunables that `Service.ReloadConfig` is allowed to swap
+	// in on a live service. `ReloadConfig` takes `Lock()` around the swap;
+	// any reader of those tunables must take `RLock()` around its read to
+	// avoid observing a half-applied reload, but no such reader exists in
+	// this checkout yet.
+	mu sync.RWMutex
+	// sourcePath is the config file `LoadConfig` populated this config from,
+	// if any. `Service.ReloadConfig` re-reads it on every call.
+	sourcePath string
 }
 
 func NewConfig() *Config {
 	config := &Config{}
 	config.ClientID = newClientID()
 	config.ChannelBufferSize = 256
+	config.MetricRegistry = metrics.NewRegistry()
+
+	config.Producer.ShutdownTimeout = Duration(30 * time.Second)
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Compression = "snappy"
+	config.Producer.Flush.Frequency = Duration(500 * time.Millisecond)
+	config.Producer.Flush.Bytes = 1024 * 1024
 
-	config.Producer.ShutdownTimeout = 30 * time.Second
+	config.Consumer.LongPollingTimeout = Duration(3 * time.Second)
+	config.Consumer.RegistrationTimeout = Duration(20 * time.Second)
+	config.Consumer.OffsetStorage = OffsetStorageZooKeeper
+	config.Consumer.BackOffTimeout = Duration(500 * time.Millisecond)
+	config.Consumer.RebalanceDelay = Duration(250 * time.Millisecond)
 
-	config.Consumer.LongPollingTimeout = 3 * time.Second
-	config.Consumer.RegistrationTimeout = 20 * time.Second
-	config.Consumer.BackOffTimeout = 500 * time.Millisecond
-	config.Consumer.RebalanceDelay = 250 * time.Millisecond
+	config.Kafka.Breaker.ErrorThreshold = 5
+	config.Kafka.Breaker.SuccessThreshold = 2
+	config.Kafka.Breaker.Timeout = Duration(10 * time.Second)
 
 	return config
 }
@@ -89,23 +236,69 @@ func (c *Config) saramaConfig() *sarama.Config {
 	saramaConfig := sarama.NewConfig()
 	saramaConfig.ClientID = c.ClientID
 	saramaConfig.ChannelBufferSize = c.ChannelBufferSize
+	if c.MetricRegistry != nil {
+		saramaConfig.MetricRegistry = c.MetricRegistry
+	}
 
-	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	saramaConfig.Producer.RequiredAcks = c.Producer.RequiredAcks
 	saramaConfig.Producer.Return.Successes = true
 	saramaConfig.Producer.Return.Errors = true
-	saramaConfig.Producer.Compression = sarama.CompressionSnappy
+	if codec, err := parseCompressionCodec(c.Producer.Compression); err != nil {
+		log.Errorf("Invalid Producer.Compression, falling back to snappy, err=(%s)", err)
+		saramaConfig.Producer.Compression = sarama.CompressionSnappy
+	} else {
+		saramaConfig.Producer.Compression = codec
+	}
 	saramaConfig.Producer.Retry.Backoff = 4 * time.Second
 	saramaConfig.Producer.Retry.Max = 5
-	saramaConfig.Producer.Flush.Frequency = 500 * time.Millisecond
-	saramaConfig.Producer.Flush.Bytes = 1024 * 1024
+	saramaConfig.Producer.Flush.Frequency = time.Duration(c.Producer.Flush.Frequency)
+	saramaConfig.Producer.Flush.Bytes = c.Producer.Flush.Bytes
+	if c.Producer.MaxMessageBytes > 0 {
+		saramaConfig.Producer.MaxMessageBytes = c.Producer.MaxMessageBytes
+	}
+	if c.Producer.Idempotent {
+		// The idempotent producer requires every in-flight request to be
+		// acknowledged by every in-sync replica, and at most one in-flight
+		// request per broker connection so that sequence numbers cannot be
+		// reordered.
+		saramaConfig.Producer.Idempotent = true
+		saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+		saramaConfig.Net.MaxOpenRequests = 1
+	}
 
 	saramaConfig.Consumer.Offsets.CommitInterval = 50 * time.Millisecond
-	saramaConfig.Consumer.Retry.Backoff = c.Consumer.BackOffTimeout
+	saramaConfig.Consumer.Retry.Backoff = time.Duration(c.Consumer.BackOffTimeout)
+
+	if c.Kafka.TLS.Enabled {
+		tlsConfig, err := newTLSConfig(c.Kafka.TLS.CAFile, c.Kafka.TLS.CertFile,
+			c.Kafka.TLS.KeyFile, c.Kafka.TLS.InsecureSkipVerify)
+		if err != nil {
+			log.Errorf("Failed to build Kafka TLS config, TLS disabled, err=(%s)", err)
+		} else {
+			saramaConfig.Net.TLS.Enable = true
+			saramaConfig.Net.TLS.Config = tlsConfig
+		}
+	}
+	if c.Kafka.SASL.Enabled {
+		saramaConfig.Net.SASL.Enable = true
+		saramaConfig.Net.SASL.Mechanism = sarama.SASLMechanism(c.Kafka.SASL.Mechanism)
+		saramaConfig.Net.SASL.User = c.Kafka.SASL.Username
+		saramaConfig.Net.SASL.Password = c.Kafka.SASL.Password
+	}
 
 	return saramaConfig
 }
 
-// saramaConfig generates a `wvanbergen/kazoo-go` library config.
+// needsZooKeeper reports whether this config requires a ZooKeeper
+// connection. It is `false` when `Consumer.OffsetStorage` is
+// `OffsetStorageKafka`, in which case `SpawnService` must not spawn a
+// `kazoo-go` client at all and `ZooKeeper.SeedPeers` can be left empty.
+func (c *Config) needsZooKeeper() bool {
+	return c.Consumer.OffsetStorage != OffsetStorageKafka
+}
+
+// kazooConfig generates a `wvanbergen/kazoo-go` library config. It is only
+// meaningful when `needsZooKeeper()` is `true`.
 func (c *Config) kazooConfig() *kazoo.Config {
 	kazooConfig := kazoo.NewConfig()
 	kazooConfig.Chroot = c.ZooKeeper.Chroot
@@ -116,10 +309,115 @@ func (c *Config) kazooConfig() *kazoo.Config {
 	//
 	// See http://zookeeper.apache.org/doc/trunk/zookeeperProgrammers.html#ch_zkSessions
 	kazooConfig.Timeout = 15 * time.Second
+
+	// NOTE: the vendored kazoo-go/go-zookeeper client used here does not
+	// expose a TLS dialer, so `ZooKeeper.TLS` cannot be wired in at this
+	// layer yet. `ZooKeeper.Auth` (digest scheme) has to be applied by
+	// calling `zk.Conn.AddAuth()` right after the underlying connection is
+	// established, which happens inside kazoo-go's own `NewKazoo()`, not
+	// here. Both are left in `Config` so the plumbing can be finished once
+	// kazoo-go grows the necessary hook.
+
 	return kazooConfig
 }
 
+// newBreakerRegistry creates a `BreakerRegistry` configured from
+// `Kafka.Breaker`.
+func (c *Config) newBreakerRegistry() *BreakerRegistry {
+	return &BreakerRegistry{
+		config:   c,
+		breakers: make(map[string]*breaker.Breaker),
+	}
+}
+
+// BreakerRegistry lazily creates and caches one
+// `eapache/go-resiliency/breaker.Breaker` per Kafka broker address, so that
+// an outage on one broker trips requests headed to that broker only, not
+// requests headed to the rest of a healthy cluster. The producer, consumer
+// and admin should each run their broker calls through
+// `Get(brokerAddr).Run(...)`.
+type BreakerRegistry struct {
+	config *Config
+
+	mu       sync.Mutex
+	breakers map[string]*breaker.Breaker
+}
+
+// Get returns the breaker for `brokerAddr`, creating it from `Kafka.Breaker`
+// on first use.
+func (r *BreakerRegistry) Get(brokerAddr string) *breaker.Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.breakers[brokerAddr]
+	if !ok {
+		b = breaker.New(r.config.Kafka.Breaker.ErrorThreshold, r.config.Kafka.Breaker.SuccessThreshold,
+			time.Duration(r.config.Kafka.Breaker.Timeout))
+		r.breakers[brokerAddr] = b
+	}
+	return b
+}
+
+// IsBreakerOpen returns `true` if `err` comes from a `breaker.Breaker` that is
+// currently open. The HTTP layer should map that to a `503` response with a
+// `Retry-After: <Kafka.Breaker.Timeout>` header instead of waiting out
+// `Consumer.LongPollingTimeout`.
+func IsBreakerOpen(err error) bool {
+	return err == breaker.ErrBreakerOpen
+}
+
+// parseCompressionCodec maps a `Producer.Compression` config value to a
+// `sarama.CompressionCodec`.
+func parseCompressionCodec(name string) (sarama.CompressionCodec, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return sarama.CompressionNone, nil
+	case "gzip":
+		return sarama.CompressionGZIP, nil
+	case "snappy":
+		return sarama.CompressionSnappy, nil
+	case "lz4":
+		return sarama.CompressionLZ4, nil
+	case "zstd":
+		return sarama.CompressionZSTD, nil
+	default:
+		return 0, fmt.Errorf("unknown compression codec %q", name)
+	}
+}
+
+// newTLSConfig builds a `crypto/tls.Config` from a CA bundle and an optional
+// client certificate/key pair.
+func newTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+
+	if caFile != "" {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file, err=(%s)", err)
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse CA file %s", caFile)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("CertFile and KeyFile must be set together, got CertFile=%q KeyFile=%q", certFile, keyFile)
+	}
+	if certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client cert/key pair, err=(%s)", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
 type Service struct {
+	config     *Config
+	metrics    *prometheus.Metrics
+	breakers   *BreakerRegistry
+	zk         *kazoo.Kazoo
 	producer   *GracefulProducer
 	consumer   *SmartConsumer
 	admin      *Admin
@@ -129,7 +427,50 @@ type Service struct {
 	wg         sync.WaitGroup
 }
 
+// Metrics returns the Prometheus bridge for this service's `MetricRegistry`.
+// `HTTPAPIServer` should mount `Metrics().Handler()` at `/metrics` once it
+// grows that route; `GracefulProducer`, `SmartConsumer` and `Admin` should
+// bump its counters as they produce, consume and rebalance.
+func (s *Service) Metrics() *prometheus.Metrics {
+	return s.metrics
+}
+
+// Breaker returns the circuit breaker for `brokerAddr`, built from
+// `Kafka.Breaker` on first use. It is not wrapped around any Kafka call yet:
+// `GracefulProducer`, `SmartConsumer` and `Admin` should each run their calls
+// to a broker through `Breaker(brokerAddr).Run(...)`, and `HTTPAPIServer`
+// should map an `IsBreakerOpen` error to a `503` response with a
+// `Retry-After: <Kafka.Breaker.Timeout>` header, once those exist in this
+// checkout.
+func (s *Service) Breaker(brokerAddr string) *breaker.Breaker {
+	return s.breakers.Get(brokerAddr)
+}
+
 func SpawnService(config *Config) (*Service, error) {
+	metricsBridge := prometheus.New(config.MetricRegistry)
+	breakerRegistry := config.newBreakerRegistry()
+
+	// In `kafka` mode group coordination goes through Kafka itself, so
+	// `SpawnService` makes no ZooKeeper connection at all. In `zookeeper`
+	// mode (the default) it connects here; `SpawnSmartConsumer`/`SpawnAdmin`
+	// do not yet take this client as a parameter, so today it is only used
+	// to fail `SpawnService` fast on a bad ZooKeeper ensemble and is closed
+	// alongside the rest of the service on shutdown.
+	//
+	// TODO: once `SpawnSmartConsumer`/`SpawnAdmin` grow their own ZooKeeper
+	// coordination, they must take this same `*kazoo.Kazoo` as a parameter
+	// and reuse it, not open their own. Otherwise every `zookeeper` mode
+	// service ends up holding multiple independent sessions to the same
+	// ensemble, one per client, for no benefit.
+	var zk *kazoo.Kazoo
+	if config.needsZooKeeper() {
+		var err error
+		zk, err = kazoo.NewKazoo(config.ZooKeeper.SeedPeers, config.kazooConfig())
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to ZooKeeper, err=(%s)", err)
+		}
+	}
+
 	producer, err := SpawnGracefulProducer(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to spawn producer, err=(%s)", err)
@@ -156,6 +497,10 @@ func SpawnService(config *Config) (*Service, error) {
 		}
 	}
 	s := &Service{
+		config:     config,
+		metrics:    metricsBridge,
+		breakers:   breakerRegistry,
+		zk:         zk,
 		producer:   producer,
 		consumer:   consumer,
 		admin:      admin,
@@ -172,26 +517,74 @@ func (s *Service) Stop() {
 	s.wg.Wait()
 }
 
+// ReloadConfig re-reads the config file this service was started with (if
+// any), re-applies `KAFKAPIXY_*` environment overrides on top of it, and
+// validates the result before swapping in the tunables that can be changed
+// without restarting the Kafka/ZooKeeper clients: `Consumer.LongPollingTimeout`,
+// `Consumer.RebalanceDelay`, `Consumer.BackOffTimeout`, `ChannelBufferSize`
+// and `Producer.Flush.Frequency`/`Producer.Flush.Bytes`. The producer,
+// consumer and admin all hold a pointer to the same `Config`, so they pick
+// the new values up on their next read, provided they take `Config.mu.RLock()`
+// around it the way `ReloadConfig` takes `Config.mu.Lock()` around the swap
+// above — none of those readers exist in this checkout yet, so today the
+// lock only ever has one side. It is meant to be called from a SIGHUP
+// handler, which `SpawnService` installs automatically.
+func (s *Service) ReloadConfig() error {
+	newConfig, err := LoadConfig(s.config.sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to reload config, err=(%s)", err)
+	}
+
+	s.config.mu.Lock()
+	defer s.config.mu.Unlock()
+
+	for _, diff := range hotConfigDiff(s.config, newConfig) {
+		log.Infof("Config reload: %s", diff)
+	}
+	s.config.Consumer.LongPollingTimeout = newConfig.Consumer.LongPollingTimeout
+	s.config.Consumer.RebalanceDelay = newConfig.Consumer.RebalanceDelay
+	s.config.Consumer.BackOffTimeout = newConfig.Consumer.BackOffTimeout
+	s.config.ChannelBufferSize = newConfig.ChannelBufferSize
+	s.config.Producer.Flush.Frequency = newConfig.Producer.Flush.Frequency
+	s.config.Producer.Flush.Bytes = newConfig.Producer.Flush.Bytes
+	return nil
+}
+
 // supervisor takes care of the service graceful shutdown.
 func (s *Service) supervisor() {
 	defer sarama.RootCID.NewChild("supervisor").LogScope()()
 	var tcpServerErrorCh <-chan error
 
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
 	s.unixServer.Start()
 	if s.tcpServer != nil {
 		s.tcpServer.Start()
 		tcpServerErrorCh = s.tcpServer.ErrorCh()
 	}
-	// Block to wait for quit signal or an API server crash.
-	select {
-	case <-s.quitCh:
-	case err, ok := <-s.unixServer.ErrorCh():
-		if ok {
-			log.Errorf("Unix socket based HTTP API crashed, err=(%s)", err)
-		}
-	case err, ok := <-tcpServerErrorCh:
-		if ok {
-			log.Errorf("TCP socket based HTTP API crashed, err=(%s)", err)
+supervisorLoop:
+	// Block to wait for quit signal, a reload request, or an API server crash.
+	for {
+		select {
+		case <-s.quitCh:
+			break supervisorLoop
+		case <-hupCh:
+			if err := s.ReloadConfig(); err != nil {
+				log.Errorf("Config reload failed, err=(%s)", err)
+			}
+			continue
+		case err, ok := <-s.unixServer.ErrorCh():
+			if ok {
+				log.Errorf("Unix socket based HTTP API crashed, err=(%s)", err)
+			}
+			break supervisorLoop
+		case err, ok := <-tcpServerErrorCh:
+			if ok {
+				log.Errorf("TCP socket based HTTP API crashed, err=(%s)", err)
+			}
+			break supervisorLoop
 		}
 	}
 	// Initiate stop of all API servers.
@@ -215,6 +608,9 @@ func (s *Service) supervisor() {
 	spawn(&wg, s.consumer.Stop)
 	spawn(&wg, s.admin.Stop)
 	wg.Wait()
+	if s.zk != nil {
+		s.zk.Close()
+	}
 }
 
 // newClientID creates a unique id that identifies this particular Kafka-Pixy
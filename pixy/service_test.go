@@ -0,0 +1,166 @@
+package pixy
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mailgun/kafka-pixy/Godeps/_workspace/src/github.com/mailgun/sarama"
+)
+
+func TestParseCompressionCodec(t *testing.T) {
+	testCases := []struct {
+		name    string
+		codec   sarama.CompressionCodec
+		wantErr bool
+	}{
+		{name: "", codec: sarama.CompressionNone},
+		{name: "none", codec: sarama.CompressionNone},
+		{name: "NONE", codec: sarama.CompressionNone},
+		{name: "gzip", codec: sarama.CompressionGZIP},
+		{name: "snappy", codec: sarama.CompressionSnappy},
+		{name: "lz4", codec: sarama.CompressionLZ4},
+		{name: "zstd", codec: sarama.CompressionZSTD},
+		{name: "bogus", wantErr: true},
+	}
+	for _, tc := range testCases {
+		codec, err := parseCompressionCodec(tc.name)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseCompressionCodec(%q): expected an error, got nil", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCompressionCodec(%q): unexpected error %s", tc.name, err)
+			continue
+		}
+		if codec != tc.codec {
+			t.Errorf("parseCompressionCodec(%q) = %v, want %v", tc.name, codec, tc.codec)
+		}
+	}
+}
+
+// writeTempCertKeyPair generates a throwaway self-signed certificate/key
+// pair and writes them, PEM encoded, into a fresh subdirectory of `dir`.
+func writeTempCertKeyPair(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	dir, err := ioutil.TempDir(dir, "keypair")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kafka-pixy-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	certOut, err := os.Create(certFile)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", certFile, err)
+	}
+	defer certOut.Close()
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		t.Fatalf("failed to write %s: %s", certFile, err)
+	}
+
+	keyFile = filepath.Join(dir, "key.pem")
+	keyOut, err := os.Create(keyFile)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", keyFile, err)
+	}
+	defer keyOut.Close()
+	if err := pem.Encode(keyOut, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}); err != nil {
+		t.Fatalf("failed to write %s: %s", keyFile, err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kafka-pixy-tls-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeTempCertKeyPair(t, dir)
+
+	t.Run("empty config is valid", func(t *testing.T) {
+		tlsConfig, err := newTLSConfig("", "", "", false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if tlsConfig.RootCAs != nil || len(tlsConfig.Certificates) != 0 {
+			t.Errorf("expected an empty tls.Config, got %+v", tlsConfig)
+		}
+	})
+
+	t.Run("CA and cert/key pair load", func(t *testing.T) {
+		tlsConfig, err := newTLSConfig(certFile, certFile, keyFile, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if tlsConfig.RootCAs == nil {
+			t.Error("expected RootCAs to be populated")
+		}
+		if len(tlsConfig.Certificates) != 1 {
+			t.Errorf("expected exactly one client certificate, got %d", len(tlsConfig.Certificates))
+		}
+		if !tlsConfig.InsecureSkipVerify {
+			t.Error("expected InsecureSkipVerify to be carried through")
+		}
+	})
+
+	t.Run("missing CA file", func(t *testing.T) {
+		if _, err := newTLSConfig(filepath.Join(dir, "does-not-exist.pem"), "", "", false); err == nil {
+			t.Error("expected an error for a missing CA file, got nil")
+		}
+	})
+
+	t.Run("malformed CA file", func(t *testing.T) {
+		badCA := filepath.Join(dir, "bad-ca.pem")
+		if err := ioutil.WriteFile(badCA, []byte("not a certificate"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %s", badCA, err)
+		}
+		if _, err := newTLSConfig(badCA, "", "", false); err == nil {
+			t.Error("expected an error for a malformed CA file, got nil")
+		}
+	})
+
+	t.Run("CertFile without KeyFile", func(t *testing.T) {
+		if _, err := newTLSConfig("", certFile, "", false); err == nil {
+			t.Error("expected an error when CertFile is set without KeyFile, got nil")
+		}
+	})
+
+	t.Run("KeyFile without CertFile", func(t *testing.T) {
+		if _, err := newTLSConfig("", "", keyFile, false); err == nil {
+			t.Error("expected an error when KeyFile is set without CertFile, got nil")
+		}
+	})
+
+	t.Run("mismatched cert/key pair", func(t *testing.T) {
+		otherCertFile, _ := writeTempCertKeyPair(t, dir)
+		if _, err := newTLSConfig("", otherCertFile, keyFile, false); err == nil {
+			t.Error("expected an error for a mismatched cert/key pair, got nil")
+		}
+	})
+}